@@ -0,0 +1,129 @@
+package repoconfig
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/bmatcuk/doublestar"
+	"github.com/pkg/errors"
+)
+
+// defaultWhenModified is the glob Atlantis watches when a project doesn't
+// set autoplan.when_modified.
+var defaultWhenModified = []string{"*.tf*"}
+
+// Autoplan controls whether and when a project is automatically planned in
+// response to a pull request's modified files.
+type Autoplan struct {
+	Enabled      bool     `yaml:"enabled"`
+	WhenModified []string `yaml:"when_modified"`
+}
+
+// autoplanAlias is used to unmarshal Autoplan so we can tell whether enabled
+// was set explicitly, which determines whether it defaults to true.
+type autoplanAlias struct {
+	Enabled      *bool    `yaml:"enabled"`
+	WhenModified []string `yaml:"when_modified"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (a *Autoplan) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var alias autoplanAlias
+	if err := unmarshal(&alias); err != nil {
+		return err
+	}
+
+	if alias.Enabled == nil {
+		a.Enabled = true
+	} else {
+		a.Enabled = *alias.Enabled
+	}
+
+	if len(alias.WhenModified) == 0 {
+		a.WhenModified = defaultWhenModified
+	} else {
+		a.WhenModified = alias.WhenModified
+	}
+	return nil
+}
+
+// defaultAutoplan is the autoplan configuration a project gets when it
+// doesn't set an autoplan key at all.
+func defaultAutoplan() Autoplan {
+	return Autoplan{
+		Enabled:      true,
+		WhenModified: defaultWhenModified,
+	}
+}
+
+// ProjectsToAutoplan returns the subset of repoDir's configured projects
+// that should be planned given modifiedFiles: their autoplan must be
+// enabled and at least one of modifiedFiles (made relative to the project's
+// Dir) must match their when_modified globs. Projects are returned in the
+// order they're defined in atlantis.yaml so callers running parallel plans
+// get deterministic behavior.
+func (r *Reader) ProjectsToAutoplan(repoDir string, modifiedFiles []string) ([]Project, error) {
+	config, err := r.ReadConfig(repoDir)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return nil, nil
+	}
+
+	var toPlan []Project
+	for _, p := range config.Projects {
+		if !p.Autoplan.Enabled {
+			continue
+		}
+		matches, err := p.Autoplan.matches(p.Dir, modifiedFiles)
+		if err != nil {
+			return nil, err
+		}
+		if matches {
+			toPlan = append(toPlan, p)
+		}
+	}
+	return toPlan, nil
+}
+
+// matches returns true if any of modifiedFiles, once made relative to
+// projectDir, match a.WhenModified.
+func (a Autoplan) matches(projectDir string, modifiedFiles []string) (bool, error) {
+	for _, f := range modifiedFiles {
+		rel, err := filepath.Rel(projectDir, f)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			// f isn't under projectDir.
+			continue
+		}
+
+		matched, err := matchesAnyGlob(a.WhenModified, filepath.ToSlash(rel))
+		if err != nil {
+			return false, err
+		}
+		if matched {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// matchesAnyGlob evaluates patterns against relPath in order, gitignore
+// style: a "!"-prefixed pattern negates an earlier match, and the last
+// matching pattern wins.
+func matchesAnyGlob(patterns []string, relPath string) (bool, error) {
+	matched := false
+	for _, pattern := range patterns {
+		negate := strings.HasPrefix(pattern, "!")
+		glob := strings.TrimPrefix(pattern, "!")
+
+		ok, err := doublestar.Match(glob, relPath)
+		if err != nil {
+			return false, errors.Wrapf(err, "invalid when_modified glob %q", pattern)
+		}
+		if ok {
+			matched = !negate
+		}
+	}
+	return matched, nil
+}
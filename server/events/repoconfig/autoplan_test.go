@@ -0,0 +1,49 @@
+package repoconfig_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/runatlantis/atlantis/server/events/repoconfig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAndValidate_AutoplanDefaults(t *testing.T) {
+	r := repoconfig.Reader{}
+	cfg, err := r.ParseAndValidate([]byte(`
+version: 3
+projects:
+- dir: .
+`))
+	require.NoError(t, err)
+	assert.True(t, cfg.Projects[0].Autoplan.Enabled)
+	assert.Equal(t, []string{"*.tf*"}, cfg.Projects[0].Autoplan.WhenModified)
+}
+
+func TestProjectsToAutoplan(t *testing.T) {
+	repoDir := t.TempDir()
+	require.NoError(t, ioutil.WriteFile(filepath.Join(repoDir, "atlantis.yaml"), []byte(`
+version: 3
+projects:
+- dir: project1
+  autoplan:
+    when_modified: ["**/*.tf", "!ignored/**"]
+- dir: project2
+  autoplan:
+    enabled: false
+- dir: project3
+`), 0600))
+
+	r := repoconfig.Reader{}
+	projects, err := r.ProjectsToAutoplan(repoDir, []string{
+		"project1/main.tf",
+		"project1/ignored/main.tf",
+		"project3/main.tf",
+	})
+	require.NoError(t, err)
+	require.Len(t, projects, 2)
+	assert.Equal(t, "project1", projects[0].Dir)
+	assert.Equal(t, "project3", projects[1].Dir)
+}
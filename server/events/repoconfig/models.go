@@ -0,0 +1,82 @@
+package repoconfig
+
+// RepoConfig is the repo's parsed and validated atlantis.yaml config.
+type RepoConfig struct {
+	Version  int       `yaml:"version"`
+	Projects []Project `yaml:"projects"`
+	// Workflows is a map of workflow name to workflow.
+	Workflows map[string]Workflow `yaml:"workflows"`
+
+	// Automerge, when set, automatically merges pull requests once all of
+	// their projects have successfully applied. Only valid with
+	// "version: 3".
+	Automerge bool `yaml:"automerge"`
+	// DeleteSourceBranchOnMerge deletes the source branch of a pull request
+	// after Atlantis automerges it. Only valid with "version: 3".
+	DeleteSourceBranchOnMerge bool `yaml:"delete_source_branch_on_merge"`
+	// ParallelPlan runs all of a pull request's plans concurrently instead
+	// of one at a time. Only valid with "version: 3".
+	ParallelPlan bool `yaml:"parallel_plan"`
+	// ParallelApply runs all of a pull request's applies concurrently
+	// instead of one at a time. Only valid with "version: 3".
+	ParallelApply bool `yaml:"parallel_apply"`
+	// AllowedRegexpPrefixes is a list of regular expressions. If set, a
+	// project's Dir must match at least one of them to be planned or
+	// applied. Only valid with "version: 3".
+	AllowedRegexpPrefixes []string `yaml:"allowed_regexp_prefixes"`
+}
+
+// Project is the configuration for one Terraform project.
+type Project struct {
+	Dir       string   `yaml:"dir"`
+	Workspace string   `yaml:"workspace"`
+	Workflow  string   `yaml:"workflow"`
+	Autoplan  Autoplan `yaml:"autoplan"`
+}
+
+// projectAlias is used to unmarshal Project so we can tell whether the
+// autoplan key was present at all, which determines whether it gets
+// Autoplan's defaults.
+type projectAlias struct {
+	Dir       string    `yaml:"dir"`
+	Workspace string    `yaml:"workspace"`
+	Workflow  string    `yaml:"workflow"`
+	Autoplan  *Autoplan `yaml:"autoplan"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (p *Project) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var alias projectAlias
+	if err := unmarshal(&alias); err != nil {
+		return err
+	}
+	p.Dir = alias.Dir
+	p.Workspace = alias.Workspace
+	p.Workflow = alias.Workflow
+	if alias.Autoplan != nil {
+		p.Autoplan = *alias.Autoplan
+	} else {
+		p.Autoplan = defaultAutoplan()
+	}
+	return nil
+}
+
+// Workflow is a set of steps to run for a project's plan and apply stages.
+type Workflow struct {
+	Plan  Stage `yaml:"plan"`
+	Apply Stage `yaml:"apply"`
+}
+
+// Stage is the configuration for a single plan or apply stage.
+type Stage struct {
+	Steps []StepConfig `yaml:"steps"`
+}
+
+// ProjectPolicy is the effective v3 policy for a single project once repo-level
+// settings have been resolved. See RepoConfig.PolicyFor.
+type ProjectPolicy struct {
+	Automerge                 bool
+	DeleteSourceBranchOnMerge bool
+	ParallelPlan              bool
+	ParallelApply             bool
+}
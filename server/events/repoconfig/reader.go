@@ -5,7 +5,9 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
+	"sync"
 
 	"github.com/hashicorp/go-version"
 	"github.com/pkg/errors"
@@ -20,6 +22,28 @@ const ApplyStageName = "apply"
 type Reader struct {
 	TerraformExecutor TerraformExec
 	DefaultTFVersion  *version.Version
+	// AvailableTFVersions is the set of terraform binaries installed on this
+	// machine, used to resolve a project's auto-detected version constraint
+	// to an actual binary. See DetectTerraformVersion.
+	AvailableTFVersions []*version.Version
+	// RemoteOpsClient confirms Terraform Cloud runs when a project uses the
+	// remote backend. It may be nil if the server isn't configured to talk
+	// to Terraform Cloud, in which case remote applies will wait for
+	// confirmation on the TFC UI instead of via `atlantis apply`.
+	RemoteOpsClient RemoteOpsClient
+
+	tfVersionCacheMu sync.Mutex
+	// tfVersionCache caches the result of DetectTerraformVersion per project,
+	// including the "no constraint found" case (a nil *version.Version), so
+	// an unpinned project's *.tf files are only ever parsed once.
+	tfVersionCache map[string]*tfVersionCacheEntry
+
+	remoteBackendCacheMu sync.Mutex
+	// remoteBackendCache caches the result of DetectRemoteBackend per
+	// project, including the "no remote backend" case (a nil
+	// *RemoteBackendConfig), so a project's *.tf files are only ever parsed
+	// once.
+	remoteBackendCache map[string]*remoteBackendCacheEntry
 }
 
 // ReadConfig returns the parsed and validated config for repoDir.
@@ -47,18 +71,31 @@ func (r *Reader) ReadConfig(repoDir string) (*RepoConfig, error) {
 	return &config, err
 }
 
-func (r *Reader) BuildPlanStage(log *logging.SimpleLogger, repoDir string, workspace string, relProjectPath string, extraCommentArgs []string, username string) (*PlanStage, error) {
-	defaults := r.defaultPlanSteps(log, repoDir, workspace, relProjectPath, extraCommentArgs, username)
-	steps, err := r.BuildStage(PlanStageName, log, repoDir, workspace, relProjectPath, extraCommentArgs, username, defaults)
+func (r *Reader) BuildPlanStage(log *logging.SimpleLogger, repoDir string, workspace string, relProjectPath string, extraCommentArgs []string, username string, baseRepoOwner string) (*PlanStage, error) {
+	defaults := r.defaultPlanSteps(log, repoDir, workspace, relProjectPath, extraCommentArgs, username, baseRepoOwner)
+	steps, err := r.BuildStage(PlanStageName, log, repoDir, workspace, relProjectPath, extraCommentArgs, username, baseRepoOwner, defaults)
+	if err != nil {
+		return nil, err
+	}
+	// Swallow-and-warn here so this agrees with buildMeta, which already
+	// detected the same project's remote backend (and cached the result) to
+	// populate each step's Meta.RemoteBackend.
+	remoteBackend, err := r.DetectRemoteBackend(repoDir, relProjectPath)
+	if err != nil {
+		log.Warn("detecting remote backend for %q: %s", relProjectPath, err)
+	}
+	policy, err := r.PolicyFor(repoDir, relProjectPath)
 	if err != nil {
 		return nil, err
 	}
 	return &PlanStage{
-		Steps: steps,
+		Steps:         steps,
+		RemoteBackend: remoteBackend,
+		Policy:        policy,
 	}, nil
 }
 
-func (r *Reader) BuildStage(stageName string, log *logging.SimpleLogger, repoDir string, workspace string, relProjectPath string, extraCommentArgs []string, username string, defaults []Step) ([]Step, error) {
+func (r *Reader) BuildStage(stageName string, log *logging.SimpleLogger, repoDir string, workspace string, relProjectPath string, extraCommentArgs []string, username string, baseRepoOwner string, defaults []Step) ([]Step, error) {
 	config, err := r.ReadConfig(repoDir)
 	if err != nil {
 		return nil, err
@@ -70,6 +107,10 @@ func (r *Reader) BuildStage(stageName string, log *logging.SimpleLogger, repoDir
 		return defaults, nil
 	}
 
+	if _, err := config.PolicyFor(relProjectPath); err != nil {
+		return nil, err
+	}
+
 	// Get this project's configuration.
 	for _, p := range config.Projects {
 		if p.Dir == relProjectPath && p.Workspace == workspace {
@@ -88,7 +129,7 @@ func (r *Reader) BuildStage(stageName string, log *logging.SimpleLogger, repoDir
 			}
 
 			// We have a workflow defined, so now we need to build it.
-			meta := r.buildMeta(log, repoDir, workspace, relProjectPath, extraCommentArgs, username)
+			meta := r.buildMeta(log, repoDir, workspace, relProjectPath, extraCommentArgs, username, baseRepoOwner)
 			var steps []Step
 			var stepsConfig []StepConfig
 			if stageName == PlanStageName {
@@ -114,8 +155,14 @@ func (r *Reader) BuildStage(stageName string, log *logging.SimpleLogger, repoDir
 						Meta:      meta,
 						ExtraArgs: stepConfig.ExtraArgs,
 					}
+				case "run":
+					step = &RunStep{
+						Meta:    meta,
+						Command: stepConfig.RunCommand,
+					}
+				default:
+					return nil, fmt.Errorf("unknown step type %q", stepConfig.StepType)
 				}
-				// todo: custom step
 				steps = append(steps, step)
 			}
 			return steps, nil
@@ -124,33 +171,66 @@ func (r *Reader) BuildStage(stageName string, log *logging.SimpleLogger, repoDir
 	return nil, fmt.Errorf("no project with dir %q and workspace %q defined", relProjectPath, workspace)
 }
 
-func (r *Reader) BuildApplyStage(log *logging.SimpleLogger, repoDir string, workspace string, relProjectPath string, extraCommentArgs []string, username string) (*ApplyStage, error) {
-	defaults := r.defaultApplySteps(log, repoDir, workspace, relProjectPath, extraCommentArgs, username)
-	steps, err := r.BuildStage(ApplyStageName, log, repoDir, workspace, relProjectPath, extraCommentArgs, username, defaults)
+func (r *Reader) BuildApplyStage(log *logging.SimpleLogger, repoDir string, workspace string, relProjectPath string, extraCommentArgs []string, username string, baseRepoOwner string) (*ApplyStage, error) {
+	defaults := r.defaultApplySteps(log, repoDir, workspace, relProjectPath, extraCommentArgs, username, baseRepoOwner)
+	steps, err := r.BuildStage(ApplyStageName, log, repoDir, workspace, relProjectPath, extraCommentArgs, username, baseRepoOwner, defaults)
+	if err != nil {
+		return nil, err
+	}
+	// Swallow-and-warn here so this agrees with buildMeta, which already
+	// detected the same project's remote backend (and cached the result) to
+	// populate each step's Meta.RemoteBackend.
+	remoteBackend, err := r.DetectRemoteBackend(repoDir, relProjectPath)
+	if err != nil {
+		log.Warn("detecting remote backend for %q: %s", relProjectPath, err)
+	}
+	policy, err := r.PolicyFor(repoDir, relProjectPath)
 	if err != nil {
 		return nil, err
 	}
 	return &ApplyStage{
-		Steps: steps,
+		Steps:         steps,
+		RemoteBackend: remoteBackend,
+		Policy:        policy,
 	}, nil
 }
 
-func (r *Reader) buildMeta(log *logging.SimpleLogger, repoDir string, workspace string, relProjectPath string, extraCommentArgs []string, username string) StepMeta {
+func (r *Reader) buildMeta(log *logging.SimpleLogger, repoDir string, workspace string, relProjectPath string, extraCommentArgs []string, username string, baseRepoOwner string) StepMeta {
+	absolutePath := filepath.Join(repoDir, relProjectPath)
+
+	// If the project doesn't pin a terraform version, try to auto-detect one
+	// from its required_version constraint before falling back to the
+	// server-wide default.
+	tfVersion := r.DefaultTFVersion
+	if detected, err := r.DetectTerraformVersion(repoDir, relProjectPath); err != nil {
+		log.Warn("detecting terraform version for %q: %s––using default %s", relProjectPath, err, r.DefaultTFVersion)
+	} else if detected != nil {
+		tfVersion = detected
+	}
+
+	remoteBackend, err := r.DetectRemoteBackend(repoDir, relProjectPath)
+	if err != nil {
+		log.Warn("detecting remote backend for %q: %s", relProjectPath, err)
+	}
+
 	return StepMeta{
 		Log:                   log,
 		Workspace:             workspace,
-		AbsolutePath:          filepath.Join(repoDir, relProjectPath),
+		AbsolutePath:          absolutePath,
 		DirRelativeToRepoRoot: relProjectPath,
-		// If there's no config then we should use the default tf version.
-		TerraformVersion:  r.DefaultTFVersion,
-		TerraformExecutor: r.TerraformExecutor,
-		ExtraCommentArgs:  extraCommentArgs,
-		Username:          username,
+		TerraformVersion:      tfVersion,
+		TerraformExecutor:     r.TerraformExecutor,
+		ExtraCommentArgs:      extraCommentArgs,
+		Username:              username,
+		BaseRepoOwner:         baseRepoOwner,
+		PlanFile:              filepath.Join(absolutePath, workspace+".tfplan"),
+		RemoteBackend:         remoteBackend,
+		RemoteOpsClient:       r.RemoteOpsClient,
 	}
 }
 
-func (r *Reader) defaultPlanSteps(log *logging.SimpleLogger, repoDir string, workspace string, relProjectPath string, extraCommentArgs []string, username string) []Step {
-	meta := r.buildMeta(log, repoDir, workspace, relProjectPath, extraCommentArgs, username)
+func (r *Reader) defaultPlanSteps(log *logging.SimpleLogger, repoDir string, workspace string, relProjectPath string, extraCommentArgs []string, username string, baseRepoOwner string) []Step {
+	meta := r.buildMeta(log, repoDir, workspace, relProjectPath, extraCommentArgs, username, baseRepoOwner)
 	return []Step{
 		&InitStep{
 			ExtraArgs: nil,
@@ -162,8 +242,8 @@ func (r *Reader) defaultPlanSteps(log *logging.SimpleLogger, repoDir string, wor
 		},
 	}
 }
-func (r *Reader) defaultApplySteps(log *logging.SimpleLogger, repoDir string, workspace string, relProjectPath string, extraCommentArgs []string, username string) []Step {
-	meta := r.buildMeta(log, repoDir, workspace, relProjectPath, extraCommentArgs, username)
+func (r *Reader) defaultApplySteps(log *logging.SimpleLogger, repoDir string, workspace string, relProjectPath string, extraCommentArgs []string, username string, baseRepoOwner string) []Step {
+	meta := r.buildMeta(log, repoDir, workspace, relProjectPath, extraCommentArgs, username, baseRepoOwner)
 	return []Step{
 		&ApplyStep{
 			ExtraArgs: nil,
@@ -182,9 +262,8 @@ func (r *Reader) ParseAndValidate(configData []byte) (RepoConfig, error) {
 	}
 
 	// Validate version.
-	if repoConfig.Version != 2 {
-		// todo: this will fail old atlantis.yaml files, we should deal with them in a better way.
-		return repoConfig, errors.New("unknown version: must have \"version: 2\" set")
+	if repoConfig.Version != 2 && repoConfig.Version != 3 {
+		return repoConfig, errors.New("unknown version: must have \"version: 2\" or \"version: 3\" set")
 	}
 
 	// Validate projects.
@@ -197,5 +276,67 @@ func (r *Reader) ParseAndValidate(configData []byte) (RepoConfig, error) {
 			return repoConfig, fmt.Errorf("project at index %d invalid: dir key must be set and non-empty", i)
 		}
 	}
+
+	// v2 configs don't have any of the v3 keys. Upgrade them in memory so
+	// downstream callers only ever need to deal with one version.
+	if repoConfig.Version == 2 && (repoConfig.Automerge || repoConfig.DeleteSourceBranchOnMerge ||
+		repoConfig.ParallelPlan || repoConfig.ParallelApply || len(repoConfig.AllowedRegexpPrefixes) > 0) {
+		return repoConfig, errors.New("automerge, delete_source_branch_on_merge, parallel_plan, parallel_apply and allowed_regexp_prefixes require \"version: 3\"")
+	}
+	repoConfig = upgradeToV3(repoConfig)
+
 	return repoConfig, nil
 }
+
+// upgradeToV3 upgrades a v2 RepoConfig to v3 by applying v3 defaults for the
+// keys that v2 doesn't support. v3 configs are returned unmodified.
+func upgradeToV3(c RepoConfig) RepoConfig {
+	if c.Version == 3 {
+		return c
+	}
+	c.Version = 3
+	return c
+}
+
+// PolicyFor returns the effective v3 policy for the project at
+// relProjectPath, resolved against repoDir's atlantis.yaml. If there's no
+// config file, it returns the zero-value ProjectPolicy (automerge and
+// parallelism off, no regexp gating).
+func (r *Reader) PolicyFor(repoDir string, relProjectPath string) (ProjectPolicy, error) {
+	config, err := r.ReadConfig(repoDir)
+	if err != nil {
+		return ProjectPolicy{}, err
+	}
+	if config == nil {
+		return ProjectPolicy{}, nil
+	}
+	return config.PolicyFor(relProjectPath)
+}
+
+// PolicyFor returns the effective v3 policy (automerge, parallelism and
+// regexp gating) for the project at relProjectPath. If the repo config sets
+// AllowedRegexpPrefixes, relProjectPath must match at least one of them or
+// an error is returned.
+func (c RepoConfig) PolicyFor(relProjectPath string) (ProjectPolicy, error) {
+	policy := ProjectPolicy{
+		Automerge:                 c.Automerge,
+		DeleteSourceBranchOnMerge: c.DeleteSourceBranchOnMerge,
+		ParallelPlan:              c.ParallelPlan,
+		ParallelApply:             c.ParallelApply,
+	}
+
+	if len(c.AllowedRegexpPrefixes) == 0 {
+		return policy, nil
+	}
+
+	for _, prefix := range c.AllowedRegexpPrefixes {
+		re, err := regexp.Compile(prefix)
+		if err != nil {
+			return policy, errors.Wrapf(err, "invalid allowed_regexp_prefixes entry %q", prefix)
+		}
+		if re.MatchString(relProjectPath) {
+			return policy, nil
+		}
+	}
+	return policy, fmt.Errorf("project %q does not match any allowed_regexp_prefixes entry", relProjectPath)
+}
@@ -0,0 +1,224 @@
+package repoconfig_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/runatlantis/atlantis/server/events/repoconfig"
+	"github.com/runatlantis/atlantis/server/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAndValidate_V2UpgradedToV3Defaults(t *testing.T) {
+	r := repoconfig.Reader{}
+	cfg, err := r.ParseAndValidate([]byte(`
+version: 2
+projects:
+- dir: .
+`))
+	require.NoError(t, err)
+	assert.Equal(t, 3, cfg.Version)
+	assert.False(t, cfg.Automerge)
+	assert.False(t, cfg.ParallelPlan)
+	assert.False(t, cfg.ParallelApply)
+	assert.Empty(t, cfg.AllowedRegexpPrefixes)
+}
+
+func TestParseAndValidate_V3PreservesExplicitSettings(t *testing.T) {
+	r := repoconfig.Reader{}
+	cfg, err := r.ParseAndValidate([]byte(`
+version: 3
+automerge: true
+parallel_plan: true
+allowed_regexp_prefixes: ["^project1"]
+projects:
+- dir: project1
+`))
+	require.NoError(t, err)
+	assert.Equal(t, 3, cfg.Version)
+	assert.True(t, cfg.Automerge)
+	assert.True(t, cfg.ParallelPlan)
+	assert.Equal(t, []string{"^project1"}, cfg.AllowedRegexpPrefixes)
+}
+
+func TestPolicyFor_ResolvesSettings(t *testing.T) {
+	r := repoconfig.Reader{}
+	cfg, err := r.ParseAndValidate([]byte(`
+version: 3
+automerge: true
+delete_source_branch_on_merge: true
+parallel_plan: true
+parallel_apply: true
+projects:
+- dir: project1
+`))
+	require.NoError(t, err)
+
+	policy, err := cfg.PolicyFor("project1")
+	require.NoError(t, err)
+	assert.Equal(t, repoconfig.ProjectPolicy{
+		Automerge:                 true,
+		DeleteSourceBranchOnMerge: true,
+		ParallelPlan:              true,
+		ParallelApply:             true,
+	}, policy)
+}
+
+func TestPolicyFor_DefaultsToAllDisabled(t *testing.T) {
+	r := repoconfig.Reader{}
+	cfg, err := r.ParseAndValidate([]byte(`
+version: 2
+projects:
+- dir: .
+`))
+	require.NoError(t, err)
+
+	policy, err := cfg.PolicyFor(".")
+	require.NoError(t, err)
+	assert.Equal(t, repoconfig.ProjectPolicy{}, policy)
+}
+
+func TestReaderPolicyFor_NoConfigFileReturnsDefaults(t *testing.T) {
+	repoDir := t.TempDir()
+	r := &repoconfig.Reader{}
+	policy, err := r.PolicyFor(repoDir, ".")
+	require.NoError(t, err)
+	assert.Equal(t, repoconfig.ProjectPolicy{}, policy)
+}
+
+func TestBuildPlanStage_SurfacesPolicy(t *testing.T) {
+	repoDir := t.TempDir()
+	writeAtlantisYAML(t, repoDir, `
+version: 3
+automerge: true
+parallel_plan: true
+projects:
+- dir: .
+  workspace: default
+`)
+
+	r := &repoconfig.Reader{}
+	stage, err := r.BuildPlanStage(testLogger(), repoDir, "default", ".", nil, "", "")
+	require.NoError(t, err)
+	assert.Equal(t, repoconfig.ProjectPolicy{Automerge: true, ParallelPlan: true}, stage.Policy)
+}
+
+func TestBuildApplyStage_SurfacesPolicy(t *testing.T) {
+	repoDir := t.TempDir()
+	writeAtlantisYAML(t, repoDir, `
+version: 3
+delete_source_branch_on_merge: true
+projects:
+- dir: .
+  workspace: default
+`)
+
+	r := &repoconfig.Reader{}
+	stage, err := r.BuildApplyStage(testLogger(), repoDir, "default", ".", nil, "", "")
+	require.NoError(t, err)
+	assert.Equal(t, repoconfig.ProjectPolicy{DeleteSourceBranchOnMerge: true}, stage.Policy)
+}
+
+func writeAtlantisYAML(t *testing.T, repoDir string, contents string) {
+	t.Helper()
+	require.NoError(t, ioutil.WriteFile(filepath.Join(repoDir, repoconfig.AtlantisYAMLFilename), []byte(contents), 0600))
+}
+
+func testLogger() *logging.SimpleLogger {
+	return logging.NewSimpleLogger("reader_test", false, logging.Info)
+}
+
+func TestBuildStage_AllowedRegexpPrefixes_Match(t *testing.T) {
+	repoDir := t.TempDir()
+	writeAtlantisYAML(t, repoDir, `
+version: 3
+allowed_regexp_prefixes: ["^project1"]
+projects:
+- dir: project1
+  workspace: default
+`)
+
+	r := &repoconfig.Reader{}
+	steps, err := r.BuildStage(repoconfig.PlanStageName, testLogger(), repoDir, "default", "project1", nil, "", "", []repoconfig.Step{})
+	require.NoError(t, err)
+	assert.Empty(t, steps)
+}
+
+func TestBuildStage_AllowedRegexpPrefixes_NoMatch(t *testing.T) {
+	repoDir := t.TempDir()
+	writeAtlantisYAML(t, repoDir, `
+version: 3
+allowed_regexp_prefixes: ["^project1"]
+projects:
+- dir: project2
+`)
+
+	r := &repoconfig.Reader{}
+	_, err := r.BuildStage(repoconfig.PlanStageName, testLogger(), repoDir, "default", "project2", nil, "", "", []repoconfig.Step{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "does not match any allowed_regexp_prefixes")
+}
+
+func TestBuildStage_AllowedRegexpPrefixes_InvalidRegexp(t *testing.T) {
+	repoDir := t.TempDir()
+	writeAtlantisYAML(t, repoDir, `
+version: 3
+allowed_regexp_prefixes: ["(unterminated"]
+projects:
+- dir: project1
+`)
+
+	r := &repoconfig.Reader{}
+	_, err := r.BuildStage(repoconfig.PlanStageName, testLogger(), repoDir, "default", "project1", nil, "", "", []repoconfig.Step{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid allowed_regexp_prefixes entry")
+}
+
+func TestBuildStage_ParsesRunStepThroughWorkflow(t *testing.T) {
+	repoDir := t.TempDir()
+	writeAtlantisYAML(t, repoDir, `
+version: 3
+projects:
+- dir: .
+  workspace: default
+  workflow: custom
+workflows:
+  custom:
+    plan:
+      steps:
+      - init
+      - run: echo hello
+`)
+
+	r := &repoconfig.Reader{}
+	steps, err := r.BuildStage(repoconfig.PlanStageName, testLogger(), repoDir, "default", ".", nil, "", "", nil)
+	require.NoError(t, err)
+	require.Len(t, steps, 2)
+	assert.IsType(t, &repoconfig.InitStep{}, steps[0])
+	runStep, ok := steps[1].(*repoconfig.RunStep)
+	require.True(t, ok, "expected second step to be a *RunStep, got %T", steps[1])
+	assert.Equal(t, "echo hello", runStep.Command)
+}
+
+func TestBuildStage_UnknownStepTypeThroughWorkflow(t *testing.T) {
+	repoDir := t.TempDir()
+	writeAtlantisYAML(t, repoDir, `
+version: 3
+projects:
+- dir: .
+  workspace: default
+  workflow: custom
+workflows:
+  custom:
+    plan:
+      steps:
+      - bogus
+`)
+
+	r := &repoconfig.Reader{}
+	_, err := r.BuildStage(repoconfig.PlanStageName, testLogger(), repoDir, "default", ".", nil, "", "", nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `unknown step type "bogus"`)
+}
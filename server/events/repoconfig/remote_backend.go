@@ -0,0 +1,146 @@
+package repoconfig
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+
+	"github.com/pkg/errors"
+)
+
+var remoteBackendOpenRegex = regexp.MustCompile(`backend\s+"remote"\s*{`)
+var cloudOpenRegex = regexp.MustCompile(`cloud\s*{`)
+var hostnameRegex = regexp.MustCompile(`hostname\s*=\s*"([^"]+)"`)
+var organizationRegex = regexp.MustCompile(`organization\s*=\s*"([^"]+)"`)
+var workspaceNameRegex = regexp.MustCompile(`workspaces\s*{[^}]*\bname\s*=\s*"([^"]+)"`)
+var workspacePrefixRegex = regexp.MustCompile(`workspaces\s*{[^}]*\bprefix\s*=\s*"([^"]+)"`)
+
+// remoteRunURLRegex matches a Terraform Cloud run URL in terraform's output,
+// ex. "https://app.terraform.io/app/my-org/my-workspace/runs/run-Cgv4uXyZ".
+// The run ID is captured as the first group.
+var remoteRunURLRegex = regexp.MustCompile(`https://\S+/app/\S+/runs/(run-\w+)`)
+
+// defaultRemoteBackendHostname is what Terraform assumes when a remote
+// backend or cloud block doesn't set hostname: Terraform Cloud's SaaS
+// instance, as opposed to a Terraform Enterprise install.
+const defaultRemoteBackendHostname = "app.terraform.io"
+
+// RemoteBackendConfig records a project's Terraform Cloud / remote backend
+// settings, detected from its "backend \"remote\"" or "cloud" block.
+type RemoteBackendConfig struct {
+	Hostname        string
+	Organization    string
+	WorkspaceName   string
+	WorkspacePrefix string
+}
+
+// remoteBackendCacheEntry wraps a cached DetectRemoteBackend result. Its
+// presence in Reader.remoteBackendCache, not Config being non-nil, is what
+// indicates a result has already been computed: Config is nil both before a
+// project's first lookup (cache miss) and after a lookup that found no
+// remote backend (cache hit, nil result). Mirrors tfVersionCacheEntry.
+type remoteBackendCacheEntry struct {
+	Config *RemoteBackendConfig
+}
+
+// DetectRemoteBackend walks the project directory at
+// filepath.Join(repoDir, relProjectPath) looking for a
+// `terraform { backend "remote" { ... } }` or `terraform { cloud { ... } }`
+// block in its *.tf files. It returns a nil config if the project doesn't
+// use a remote backend. Results, including the "no remote backend found"
+// case, are cached per (repoDir, relProjectPath) since the underlying files
+// don't change between a project's plan and apply.
+func (r *Reader) DetectRemoteBackend(repoDir string, relProjectPath string) (*RemoteBackendConfig, error) {
+	absProjectPath := filepath.Join(repoDir, relProjectPath)
+
+	r.remoteBackendCacheMu.Lock()
+	if cached, ok := r.remoteBackendCache[absProjectPath]; ok {
+		r.remoteBackendCacheMu.Unlock()
+		return cached.Config, nil
+	}
+	r.remoteBackendCacheMu.Unlock()
+
+	cfg, err := findRemoteBackend(absProjectPath)
+	if err != nil {
+		return nil, err
+	}
+
+	r.remoteBackendCacheMu.Lock()
+	if r.remoteBackendCache == nil {
+		r.remoteBackendCache = make(map[string]*remoteBackendCacheEntry)
+	}
+	r.remoteBackendCache[absProjectPath] = &remoteBackendCacheEntry{Config: cfg}
+	r.remoteBackendCacheMu.Unlock()
+
+	return cfg, nil
+}
+
+// findRemoteBackend scans the *.tf files directly inside absProjectPath for
+// a remote backend or cloud block and returns the settings it declares, or
+// a nil config if none is found.
+func findRemoteBackend(absProjectPath string) (*RemoteBackendConfig, error) {
+	tfFiles, err := filepath.Glob(filepath.Join(absProjectPath, "*.tf"))
+	if err != nil {
+		return nil, errors.Wrapf(err, "globbing for *.tf files in %q", absProjectPath)
+	}
+
+	for _, f := range tfFiles {
+		contents, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading %q", f)
+		}
+
+		block, ok := extractBraceBlock(contents, remoteBackendOpenRegex)
+		if !ok {
+			block, ok = extractBraceBlock(contents, cloudOpenRegex)
+		}
+		if !ok {
+			continue
+		}
+
+		blockBytes := []byte(block)
+		cfg := &RemoteBackendConfig{Hostname: defaultRemoteBackendHostname}
+		if m := hostnameRegex.FindSubmatch(blockBytes); m != nil {
+			cfg.Hostname = string(m[1])
+		}
+		if m := organizationRegex.FindSubmatch(blockBytes); m != nil {
+			cfg.Organization = string(m[1])
+		}
+		if m := workspaceNameRegex.FindSubmatch(blockBytes); m != nil {
+			cfg.WorkspaceName = string(m[1])
+		}
+		if m := workspacePrefixRegex.FindSubmatch(blockBytes); m != nil {
+			cfg.WorkspacePrefix = string(m[1])
+		}
+		return cfg, nil
+	}
+	return nil, nil
+}
+
+// extractBraceBlock finds the first match of openRegex in contents, which
+// must end at the block's opening "{", and returns the text up to its
+// matching closing "}" by scanning brace depth. This correctly skips over
+// nested blocks (ex. a "workspaces { ... }" sub-block) instead of stopping
+// at the first "}" encountered, which could belong to a nested block. ok is
+// false if openRegex doesn't match or the block is unterminated.
+func extractBraceBlock(contents []byte, openRegex *regexp.Regexp) (string, bool) {
+	loc := openRegex.FindIndex(contents)
+	if loc == nil {
+		return "", false
+	}
+
+	depth := 1
+	start := loc[1]
+	for i := start; i < len(contents); i++ {
+		switch contents[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return string(contents[start:i]), true
+			}
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,227 @@
+package repoconfig_test
+
+import (
+	"testing"
+
+	version "github.com/hashicorp/go-version"
+	"github.com/runatlantis/atlantis/server/events/repoconfig"
+	"github.com/runatlantis/atlantis/server/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectRemoteBackend_Remote(t *testing.T) {
+	tmp := t.TempDir()
+	writeTF(t, tmp, `terraform {
+  backend "remote" {
+    hostname     = "app.terraform.io"
+    organization = "my-org"
+
+    workspaces {
+      name = "my-workspace"
+    }
+  }
+}`)
+
+	r := &repoconfig.Reader{}
+	cfg, err := r.DetectRemoteBackend(tmp, ".")
+	require.NoError(t, err)
+	require.NotNil(t, cfg)
+	assert.Equal(t, "app.terraform.io", cfg.Hostname)
+	assert.Equal(t, "my-org", cfg.Organization)
+	assert.Equal(t, "my-workspace", cfg.WorkspaceName)
+}
+
+func TestDetectRemoteBackend_Remote_WorkspacesBeforeAttrs(t *testing.T) {
+	tmp := t.TempDir()
+	writeTF(t, tmp, `terraform {
+  backend "remote" {
+    workspaces {
+      name = "my-workspace"
+    }
+
+    hostname     = "app.terraform.io"
+    organization = "my-org"
+  }
+}`)
+
+	r := &repoconfig.Reader{}
+	cfg, err := r.DetectRemoteBackend(tmp, ".")
+	require.NoError(t, err)
+	require.NotNil(t, cfg)
+	assert.Equal(t, "app.terraform.io", cfg.Hostname)
+	assert.Equal(t, "my-org", cfg.Organization)
+	assert.Equal(t, "my-workspace", cfg.WorkspaceName)
+}
+
+func TestDetectRemoteBackend_Cloud(t *testing.T) {
+	tmp := t.TempDir()
+	writeTF(t, tmp, `terraform {
+  cloud {
+    organization = "my-org"
+
+    workspaces {
+      prefix = "app-"
+    }
+  }
+}`)
+
+	r := &repoconfig.Reader{}
+	cfg, err := r.DetectRemoteBackend(tmp, ".")
+	require.NoError(t, err)
+	require.NotNil(t, cfg)
+	assert.Equal(t, "app.terraform.io", cfg.Hostname)
+	assert.Equal(t, "app-", cfg.WorkspacePrefix)
+}
+
+func TestDetectRemoteBackend_None(t *testing.T) {
+	tmp := t.TempDir()
+	writeTF(t, tmp, `resource "null_resource" "this" {}`)
+
+	r := &repoconfig.Reader{}
+	cfg, err := r.DetectRemoteBackend(tmp, ".")
+	require.NoError(t, err)
+	assert.Nil(t, cfg)
+}
+
+func TestDetectRemoteBackend_CachesResult(t *testing.T) {
+	tmp := t.TempDir()
+	writeTF(t, tmp, `terraform {
+  backend "remote" {
+    organization = "my-org"
+
+    workspaces {
+      name = "my-workspace"
+    }
+  }
+}`)
+
+	r := &repoconfig.Reader{}
+	cfg, err := r.DetectRemoteBackend(tmp, ".")
+	require.NoError(t, err)
+	require.NotNil(t, cfg)
+	assert.Equal(t, "my-org", cfg.Organization)
+
+	// Change the workspace's organization. If the first result wasn't
+	// cached, this second call would re-parse the file and pick it up.
+	writeTF(t, tmp, `terraform {
+  backend "remote" {
+    organization = "other-org"
+
+    workspaces {
+      name = "my-workspace"
+    }
+  }
+}`)
+	cfg, err = r.DetectRemoteBackend(tmp, ".")
+	require.NoError(t, err)
+	require.NotNil(t, cfg)
+	assert.Equal(t, "my-org", cfg.Organization, "expected the cached result, not a re-parse of the updated file")
+}
+
+func TestDetectRemoteBackend_None_CachesNilResult(t *testing.T) {
+	tmp := t.TempDir()
+	writeTF(t, tmp, `resource "null_resource" "this" {}`)
+
+	r := &repoconfig.Reader{}
+	cfg, err := r.DetectRemoteBackend(tmp, ".")
+	require.NoError(t, err)
+	assert.Nil(t, cfg)
+
+	// Now add a remote backend block. If the first, no-backend result
+	// wasn't cached, this second call would re-parse the file and pick it
+	// up.
+	writeTF(t, tmp, `terraform {
+  backend "remote" {
+    organization = "my-org"
+  }
+}`)
+	cfg, err = r.DetectRemoteBackend(tmp, ".")
+	require.NoError(t, err)
+	assert.Nil(t, cfg, "expected the cached nil result, not a re-parse of the updated file")
+}
+
+type fakeTerraformExec struct {
+	streamingOut string
+}
+
+func (f *fakeTerraformExec) RunCommandWithVersion(_ *logging.SimpleLogger, _ string, _ []string, _ *version.Version, _ string) (string, error) {
+	return "", nil
+}
+
+func (f *fakeTerraformExec) RunCommandWithVersionStreaming(_ *logging.SimpleLogger, _ string, _ []string, _ *version.Version, _ string) (string, error) {
+	return f.streamingOut, nil
+}
+
+func TestPlanStep_Run_RejectsOutFlagOnRemoteBackend(t *testing.T) {
+	s := repoconfig.PlanStep{
+		ExtraArgs: []string{"-out=planfile"},
+		Meta: repoconfig.StepMeta{
+			RemoteBackend: &repoconfig.RemoteBackendConfig{Hostname: "app.terraform.io"},
+		},
+	}
+	_, err := s.Run()
+	assert.Error(t, err)
+}
+
+type fakeRemoteOpsClient struct {
+	confirmedHostname string
+	confirmedRunID    string
+}
+
+func (f *fakeRemoteOpsClient) ConfirmRun(hostname string, runID string) error {
+	f.confirmedHostname = hostname
+	f.confirmedRunID = runID
+	return nil
+}
+
+func TestApplyStep_Run_ConfirmsRemoteRun(t *testing.T) {
+	client := &fakeRemoteOpsClient{}
+	s := repoconfig.ApplyStep{
+		Meta: repoconfig.StepMeta{
+			TerraformExecutor: &fakeTerraformExec{
+				streamingOut: "Apply complete!\nhttps://app.terraform.io/app/my-org/my-workspace/runs/run-Cgv4uXyZ\n",
+			},
+			RemoteBackend:   &repoconfig.RemoteBackendConfig{Hostname: "app.terraform.io"},
+			RemoteOpsClient: client,
+		},
+	}
+	_, err := s.Run()
+	require.NoError(t, err)
+	assert.Equal(t, "run-Cgv4uXyZ", client.confirmedRunID)
+	assert.Equal(t, "app.terraform.io", client.confirmedHostname)
+}
+
+func TestApplyStage_RemoteRunURL_PopulatedAfterRun(t *testing.T) {
+	s := &repoconfig.ApplyStep{
+		Meta: repoconfig.StepMeta{
+			TerraformExecutor: &fakeTerraformExec{
+				streamingOut: "Apply complete!\nhttps://app.terraform.io/app/my-org/my-workspace/runs/run-Cgv4uXyZ\n",
+			},
+			RemoteBackend: &repoconfig.RemoteBackendConfig{Hostname: "app.terraform.io"},
+		},
+	}
+	stage := &repoconfig.ApplyStage{Steps: []repoconfig.Step{s}}
+	assert.Empty(t, stage.RemoteRunURL(), "run hasn't happened yet")
+
+	_, err := s.Run()
+	require.NoError(t, err)
+	assert.Equal(t, "https://app.terraform.io/app/my-org/my-workspace/runs/run-Cgv4uXyZ", stage.RemoteRunURL())
+}
+
+func TestPlanStage_RemoteRunURL_PopulatedAfterRun(t *testing.T) {
+	s := &repoconfig.PlanStep{
+		Meta: repoconfig.StepMeta{
+			TerraformExecutor: &fakeTerraformExec{
+				streamingOut: "Plan generated.\nhttps://app.terraform.io/app/my-org/my-workspace/runs/run-Cgv4uXyZ\n",
+			},
+			RemoteBackend: &repoconfig.RemoteBackendConfig{Hostname: "app.terraform.io"},
+		},
+	}
+	stage := &repoconfig.PlanStage{Steps: []repoconfig.Step{s}}
+	assert.Empty(t, stage.RemoteRunURL(), "run hasn't happened yet")
+
+	_, err := s.Run()
+	require.NoError(t, err)
+	assert.Equal(t, "https://app.terraform.io/app/my-org/my-workspace/runs/run-Cgv4uXyZ", stage.RemoteRunURL())
+}
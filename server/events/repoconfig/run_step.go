@@ -0,0 +1,48 @@
+package repoconfig
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// RunStep runs a user-defined shell command, ex.
+//
+//	run: "./my-script.sh"
+//
+// It's the escape hatch for anything that isn't one of the built-in
+// init/plan/apply steps.
+type RunStep struct {
+	Meta StepMeta
+	// Command is the shell command to run, ex. "./my-script.sh".
+	Command string
+}
+
+// Run implements Step. It executes Command with `sh -c` in a shell rooted at
+// Meta.AbsolutePath, with the project's context injected as environment
+// variables, and returns its combined stdout/stderr.
+func (s *RunStep) Run() (string, error) {
+	cmd := exec.Command("sh", "-c", s.Command)
+	cmd.Dir = s.Meta.AbsolutePath
+	cmd.Env = append(os.Environ(),
+		"WORKSPACE="+s.Meta.Workspace,
+		"DIR="+s.Meta.AbsolutePath,
+		"PLANFILE="+s.Meta.PlanFile,
+		"BASE_REPO_OWNER="+s.Meta.BaseRepoOwner,
+		"USER_NAME="+s.Meta.Username,
+		"COMMENT_ARGS="+strings.Join(s.Meta.ExtraCommentArgs, ","),
+	)
+	// TerraformVersion may be nil if the project has no pinned or
+	// auto-detected version and the server has no default configured.
+	if s.Meta.TerraformVersion != nil {
+		cmd.Env = append(cmd.Env, "ATLANTIS_TERRAFORM_VERSION="+s.Meta.TerraformVersion.String())
+	}
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return string(out), errors.Wrapf(err, "running %q in %q", s.Command, s.Meta.AbsolutePath)
+	}
+	return string(out), nil
+}
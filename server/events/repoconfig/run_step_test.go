@@ -0,0 +1,55 @@
+package repoconfig_test
+
+import (
+	"testing"
+
+	version "github.com/hashicorp/go-version"
+	"github.com/runatlantis/atlantis/server/events/repoconfig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunStep_Run_CapturesStdout(t *testing.T) {
+	v, err := version.NewVersion("0.11.13")
+	require.NoError(t, err)
+
+	s := repoconfig.RunStep{
+		Command: "echo hi",
+		Meta: repoconfig.StepMeta{
+			AbsolutePath:     t.TempDir(),
+			TerraformVersion: v,
+		},
+	}
+	out, err := s.Run()
+	assert.NoError(t, err)
+	assert.Equal(t, "hi\n", out)
+}
+
+func TestRunStep_Run_NilTerraformVersion(t *testing.T) {
+	s := repoconfig.RunStep{
+		Command: "echo hi",
+		Meta: repoconfig.StepMeta{
+			AbsolutePath: t.TempDir(),
+			// TerraformVersion intentionally left nil, ex. no pinned/
+			// detected version and no server-wide default configured.
+		},
+	}
+	out, err := s.Run()
+	assert.NoError(t, err)
+	assert.Equal(t, "hi\n", out)
+}
+
+func TestRunStep_Run_NonZeroExit(t *testing.T) {
+	v, err := version.NewVersion("0.11.13")
+	require.NoError(t, err)
+
+	s := repoconfig.RunStep{
+		Command: "exit 1",
+		Meta: repoconfig.StepMeta{
+			AbsolutePath:     t.TempDir(),
+			TerraformVersion: v,
+		},
+	}
+	_, err = s.Run()
+	assert.Error(t, err)
+}
@@ -0,0 +1,49 @@
+package repoconfig
+
+// PlanStage is the set of steps to run when planning a project.
+type PlanStage struct {
+	Steps []Step
+	// RemoteBackend is set if the project uses a Terraform Cloud / remote
+	// backend, so the server layer can surface its run URL in the PR
+	// comment instead of a local plan summary.
+	RemoteBackend *RemoteBackendConfig
+	// Policy is the project's effective automerge/parallelism settings,
+	// resolved from the repo's atlantis.yaml. See RepoConfig.PolicyFor.
+	Policy ProjectPolicy
+}
+
+// RemoteRunURL returns the Terraform Cloud run URL captured by this stage's
+// PlanStep the last time it ran, or "" if Steps hasn't been run yet, didn't
+// include a PlanStep, or didn't use a remote backend.
+func (s *PlanStage) RemoteRunURL() string {
+	for _, step := range s.Steps {
+		if p, ok := step.(*PlanStep); ok {
+			return p.RunURL
+		}
+	}
+	return ""
+}
+
+// ApplyStage is the set of steps to run when applying a project.
+type ApplyStage struct {
+	Steps []Step
+	// RemoteBackend is set if the project uses a Terraform Cloud / remote
+	// backend, so the server layer can surface its run URL in the PR
+	// comment instead of a local apply summary.
+	RemoteBackend *RemoteBackendConfig
+	// Policy is the project's effective automerge/parallelism settings,
+	// resolved from the repo's atlantis.yaml. See RepoConfig.PolicyFor.
+	Policy ProjectPolicy
+}
+
+// RemoteRunURL returns the Terraform Cloud run URL captured by this stage's
+// ApplyStep the last time it ran, or "" if Steps hasn't been run yet, didn't
+// include an ApplyStep, or didn't use a remote backend.
+func (s *ApplyStage) RemoteRunURL() string {
+	for _, step := range s.Steps {
+		if a, ok := step.(*ApplyStep); ok {
+			return a.RunURL
+		}
+	}
+	return ""
+}
@@ -0,0 +1,153 @@
+package repoconfig
+
+import (
+	"strings"
+
+	"github.com/hashicorp/go-version"
+	"github.com/pkg/errors"
+	"github.com/runatlantis/atlantis/server/logging"
+)
+
+// rejectOutFlag returns an error if extraArgs sets -out, which Terraform
+// Cloud's remote backend rejects since it doesn't produce a local planfile.
+func rejectOutFlag(extraArgs []string) error {
+	for _, a := range extraArgs {
+		if strings.HasPrefix(a, "-out") {
+			return errors.New("-out cannot be used with the remote backend: Terraform Cloud doesn't support local planfiles")
+		}
+	}
+	return nil
+}
+
+// logRemoteRunURL logs out's Terraform Cloud run URL, if any, and returns
+// the run's URL and ID.
+func logRemoteRunURL(meta StepMeta, out string) (runURL string, runID string) {
+	match := remoteRunURLRegex.FindStringSubmatch(out)
+	if match == nil {
+		return "", ""
+	}
+	if meta.Log != nil {
+		meta.Log.Info("Terraform Cloud run: %s", match[0])
+	}
+	return match[0], match[1]
+}
+
+// TerraformExec runs terraform commands against a project.
+type TerraformExec interface {
+	RunCommandWithVersion(log *logging.SimpleLogger, path string, args []string, v *version.Version, workspace string) (string, error)
+	// RunCommandWithVersionStreaming is like RunCommandWithVersion but
+	// streams each line of output to log as it's produced instead of only
+	// returning it once the command exits. It's used for remote backend
+	// operations, where a plan or apply can take a long time to run on
+	// Terraform Cloud and the user shouldn't have to wait for it to finish
+	// to see progress.
+	RunCommandWithVersionStreaming(log *logging.SimpleLogger, path string, args []string, v *version.Version, workspace string) (string, error)
+}
+
+// RemoteOpsClient confirms a Terraform Cloud run via the TFC API. It's used
+// to map an `atlantis apply` comment to a TFC run confirmation when a
+// project's apply is running against a remote backend.
+type RemoteOpsClient interface {
+	ConfirmRun(hostname string, runID string) error
+}
+
+// StepMeta is the data available to every step when it runs.
+type StepMeta struct {
+	Log                   *logging.SimpleLogger
+	Workspace             string
+	AbsolutePath          string
+	DirRelativeToRepoRoot string
+	TerraformVersion      *version.Version
+	TerraformExecutor     TerraformExec
+	ExtraCommentArgs      []string
+	Username              string
+	// BaseRepoOwner is the owner of the repo the pull request is against.
+	BaseRepoOwner string
+	// PlanFile is the absolute path to the planfile for this project and
+	// workspace.
+	PlanFile string
+	// RemoteBackend is set if the project uses a Terraform Cloud / remote
+	// backend, detected from its "backend \"remote\"" or "cloud" block.
+	RemoteBackend *RemoteBackendConfig
+	// RemoteOpsClient confirms TFC runs when RemoteBackend is set.
+	RemoteOpsClient RemoteOpsClient
+}
+
+// Step is a single step in a plan or apply stage.
+type Step interface {
+	// Run executes the step and returns its output.
+	Run() (string, error)
+}
+
+// InitStep runs `terraform init`.
+type InitStep struct {
+	Meta      StepMeta
+	ExtraArgs []string
+}
+
+// Run implements Step.
+func (i *InitStep) Run() (string, error) {
+	args := append([]string{"init"}, i.ExtraArgs...)
+	return i.Meta.TerraformExecutor.RunCommandWithVersion(i.Meta.Log, i.Meta.AbsolutePath, args, i.Meta.TerraformVersion, i.Meta.Workspace)
+}
+
+// PlanStep runs `terraform plan`.
+type PlanStep struct {
+	Meta      StepMeta
+	ExtraArgs []string
+	// RunURL is the Terraform Cloud run URL captured from this step's most
+	// recent Run, if it ran against a remote backend and produced one. See
+	// PlanStage.RemoteRunURL.
+	RunURL string
+}
+
+// Run implements Step.
+func (p *PlanStep) Run() (string, error) {
+	if p.Meta.RemoteBackend != nil {
+		if err := rejectOutFlag(p.ExtraArgs); err != nil {
+			return "", err
+		}
+		args := append([]string{"plan"}, p.ExtraArgs...)
+		out, err := p.Meta.TerraformExecutor.RunCommandWithVersionStreaming(p.Meta.Log, p.Meta.AbsolutePath, args, p.Meta.TerraformVersion, p.Meta.Workspace)
+		p.RunURL, _ = logRemoteRunURL(p.Meta, out)
+		return out, err
+	}
+
+	args := append([]string{"plan"}, p.ExtraArgs...)
+	return p.Meta.TerraformExecutor.RunCommandWithVersion(p.Meta.Log, p.Meta.AbsolutePath, args, p.Meta.TerraformVersion, p.Meta.Workspace)
+}
+
+// ApplyStep runs `terraform apply`.
+type ApplyStep struct {
+	Meta      StepMeta
+	ExtraArgs []string
+	// RunURL is the Terraform Cloud run URL captured from this step's most
+	// recent Run, if it ran against a remote backend and produced one. See
+	// ApplyStage.RemoteRunURL.
+	RunURL string
+}
+
+// Run implements Step.
+func (a *ApplyStep) Run() (string, error) {
+	if a.Meta.RemoteBackend != nil {
+		if err := rejectOutFlag(a.ExtraArgs); err != nil {
+			return "", err
+		}
+		args := append([]string{"apply"}, a.ExtraArgs...)
+		out, err := a.Meta.TerraformExecutor.RunCommandWithVersionStreaming(a.Meta.Log, a.Meta.AbsolutePath, args, a.Meta.TerraformVersion, a.Meta.Workspace)
+		runURL, runID := logRemoteRunURL(a.Meta, out)
+		a.RunURL = runURL
+		if err != nil {
+			return out, err
+		}
+		if runID != "" && a.Meta.RemoteOpsClient != nil {
+			if err := a.Meta.RemoteOpsClient.ConfirmRun(a.Meta.RemoteBackend.Hostname, runID); err != nil {
+				return out, errors.Wrapf(err, "confirming Terraform Cloud run %q", runID)
+			}
+		}
+		return out, nil
+	}
+
+	args := append([]string{"apply"}, a.ExtraArgs...)
+	return a.Meta.TerraformExecutor.RunCommandWithVersion(a.Meta.Log, a.Meta.AbsolutePath, args, a.Meta.TerraformVersion, a.Meta.Workspace)
+}
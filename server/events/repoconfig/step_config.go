@@ -0,0 +1,49 @@
+package repoconfig
+
+import "github.com/pkg/errors"
+
+// StepConfig is the raw, parsed representation of a single step in a plan
+// or apply stage. It supports three shapes in atlantis.yaml:
+//   - a bare string naming a built-in step, ex. "init"
+//   - a map with a single built-in step name key, ex.
+//     {plan: {extra_args: ["-lock=false"]}}
+//   - a map with a "run" key whose value is a shell command, ex.
+//     {run: "my-script.sh"}
+type StepConfig struct {
+	StepType   string
+	RunCommand string
+	ExtraArgs  []string
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (s *StepConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var asString string
+	if err := unmarshal(&asString); err == nil {
+		s.StepType = asString
+		return nil
+	}
+
+	var asRunMap map[string]string
+	if err := unmarshal(&asRunMap); err == nil && len(asRunMap) == 1 {
+		if cmd, ok := asRunMap["run"]; ok {
+			s.StepType = "run"
+			s.RunCommand = cmd
+			return nil
+		}
+	}
+
+	var asArgsMap map[string]struct {
+		ExtraArgs []string `yaml:"extra_args"`
+	}
+	if err := unmarshal(&asArgsMap); err != nil {
+		return err
+	}
+	if len(asArgsMap) != 1 {
+		return errors.New("step element must have a single key, ex. \"init\" or \"run\"")
+	}
+	for k, v := range asArgsMap {
+		s.StepType = k
+		s.ExtraArgs = v.ExtraArgs
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package repoconfig
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/go-version"
+	"github.com/pkg/errors"
+)
+
+var requiredVersionRegex = regexp.MustCompile(`required_version\s*=\s*"([^"]+)"`)
+
+// tfVersionCacheEntry wraps a cached DetectTerraformVersion result.
+// Its presence in Reader.tfVersionCache, not Version being non-nil, is what
+// indicates a result has already been computed: Version is nil both before
+// a project's first lookup (cache miss) and after a lookup that found no
+// required_version constraint (cache hit, nil result).
+type tfVersionCacheEntry struct {
+	Version *version.Version
+}
+
+// DetectTerraformVersion walks the project directory at
+// filepath.Join(repoDir, relProjectPath) looking for a
+// `terraform { required_version = "..." }` constraint in its *.tf files and
+// returns the highest version in r.AvailableTFVersions that satisfies it.
+// If no constraint is found it returns a nil version and a nil error so
+// callers can fall back to their own default. Results, including the "no
+// constraint found" case, are cached per (repoDir, relProjectPath) since the
+// underlying files don't change between a project's plan and apply.
+func (r *Reader) DetectTerraformVersion(repoDir string, relProjectPath string) (*version.Version, error) {
+	absProjectPath := filepath.Join(repoDir, relProjectPath)
+
+	r.tfVersionCacheMu.Lock()
+	if cached, ok := r.tfVersionCache[absProjectPath]; ok {
+		r.tfVersionCacheMu.Unlock()
+		return cached.Version, nil
+	}
+	r.tfVersionCacheMu.Unlock()
+
+	constraintStr, err := findRequiredVersion(absProjectPath)
+	if err != nil {
+		return nil, err
+	}
+	if constraintStr == "" {
+		r.cacheTFVersion(absProjectPath, nil)
+		return nil, nil
+	}
+
+	constraints, err := version.NewConstraint(constraintStr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing required_version constraint %q", constraintStr)
+	}
+
+	resolved, err := r.highestSatisfying(constraints)
+	if err != nil {
+		return nil, err
+	}
+
+	r.cacheTFVersion(absProjectPath, resolved)
+	return resolved, nil
+}
+
+func (r *Reader) cacheTFVersion(absProjectPath string, v *version.Version) {
+	r.tfVersionCacheMu.Lock()
+	defer r.tfVersionCacheMu.Unlock()
+	if r.tfVersionCache == nil {
+		r.tfVersionCache = make(map[string]*tfVersionCacheEntry)
+	}
+	r.tfVersionCache[absProjectPath] = &tfVersionCacheEntry{Version: v}
+}
+
+// findRequiredVersion returns the combined required_version constraint
+// string found across all *.tf files directly inside absProjectPath, or ""
+// if none declare one.
+func findRequiredVersion(absProjectPath string) (string, error) {
+	tfFiles, err := filepath.Glob(filepath.Join(absProjectPath, "*.tf"))
+	if err != nil {
+		return "", errors.Wrapf(err, "globbing for *.tf files in %q", absProjectPath)
+	}
+
+	var constraints []string
+	for _, f := range tfFiles {
+		contents, err := ioutil.ReadFile(f)
+		if err != nil {
+			return "", errors.Wrapf(err, "reading %q", f)
+		}
+		for _, match := range requiredVersionRegex.FindAllStringSubmatch(string(contents), -1) {
+			constraints = append(constraints, match[1])
+		}
+	}
+	return strings.Join(constraints, ", "), nil
+}
+
+// highestSatisfying returns the highest version in r.AvailableTFVersions that
+// satisfies constraints.
+func (r *Reader) highestSatisfying(constraints version.Constraints) (*version.Version, error) {
+	candidates := make([]*version.Version, len(r.AvailableTFVersions))
+	copy(candidates, r.AvailableTFVersions)
+	sort.Sort(sort.Reverse(version.Collection(candidates)))
+
+	for _, v := range candidates {
+		if constraints.Check(v) {
+			return v, nil
+		}
+	}
+	return nil, fmt.Errorf("no installed terraform version satisfies constraint %q", constraints)
+}
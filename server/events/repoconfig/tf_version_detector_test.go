@@ -0,0 +1,119 @@
+package repoconfig_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	version "github.com/hashicorp/go-version"
+	"github.com/runatlantis/atlantis/server/events/repoconfig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mustVersion(t *testing.T, v string) *version.Version {
+	t.Helper()
+	parsed, err := version.NewVersion(v)
+	require.NoError(t, err)
+	return parsed
+}
+
+func writeTF(t *testing.T, dir string, contents string) {
+	t.Helper()
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "main.tf"), []byte(contents), 0600))
+}
+
+func TestDetectTerraformVersion_Pinned(t *testing.T) {
+	tmp := t.TempDir()
+	writeTF(t, tmp, `terraform {
+  required_version = "= 0.12.24"
+}`)
+
+	r := &repoconfig.Reader{
+		AvailableTFVersions: []*version.Version{
+			mustVersion(t, "0.11.14"),
+			mustVersion(t, "0.12.24"),
+			mustVersion(t, "0.12.25"),
+		},
+	}
+	got, err := r.DetectTerraformVersion(tmp, ".")
+	require.NoError(t, err)
+	assert.Equal(t, "0.12.24", got.String())
+}
+
+func TestDetectTerraformVersion_Range(t *testing.T) {
+	tmp := t.TempDir()
+	writeTF(t, tmp, `terraform {
+  required_version = ">= 0.11, < 0.13"
+}`)
+
+	r := &repoconfig.Reader{
+		AvailableTFVersions: []*version.Version{
+			mustVersion(t, "0.11.14"),
+			mustVersion(t, "0.12.29"),
+			mustVersion(t, "0.13.5"),
+		},
+	}
+	got, err := r.DetectTerraformVersion(tmp, ".")
+	require.NoError(t, err)
+	assert.Equal(t, "0.12.29", got.String())
+}
+
+func TestDetectTerraformVersion_Missing(t *testing.T) {
+	tmp := t.TempDir()
+	writeTF(t, tmp, `resource "null_resource" "this" {}`)
+
+	r := &repoconfig.Reader{
+		AvailableTFVersions: []*version.Version{mustVersion(t, "0.12.29")},
+	}
+	got, err := r.DetectTerraformVersion(tmp, ".")
+	require.NoError(t, err)
+	assert.Nil(t, got)
+}
+
+func TestDetectTerraformVersion_Missing_CachesNilResult(t *testing.T) {
+	tmp := t.TempDir()
+	writeTF(t, tmp, `resource "null_resource" "this" {}`)
+
+	r := &repoconfig.Reader{
+		AvailableTFVersions: []*version.Version{mustVersion(t, "0.12.29")},
+	}
+	got, err := r.DetectTerraformVersion(tmp, ".")
+	require.NoError(t, err)
+	assert.Nil(t, got)
+
+	// Now pin a constraint. If the first, no-constraint result wasn't
+	// cached, this second call would re-parse the file and pick it up.
+	writeTF(t, tmp, `terraform {
+  required_version = "= 0.12.29"
+}`)
+	got, err = r.DetectTerraformVersion(tmp, ".")
+	require.NoError(t, err)
+	assert.Nil(t, got, "expected the cached no-constraint result, not a re-parse of the updated file")
+}
+
+func TestDetectTerraformVersion_InvalidConstraint(t *testing.T) {
+	tmp := t.TempDir()
+	writeTF(t, tmp, `terraform {
+  required_version = "not-a-constraint!!"
+}`)
+
+	r := &repoconfig.Reader{
+		AvailableTFVersions: []*version.Version{mustVersion(t, "0.12.29")},
+	}
+	_, err := r.DetectTerraformVersion(tmp, ".")
+	assert.Error(t, err)
+}
+
+func TestDetectTerraformVersion_NoneSatisfy(t *testing.T) {
+	tmp := t.TempDir()
+	writeTF(t, tmp, `terraform {
+  required_version = ">= 0.13"
+}`)
+
+	r := &repoconfig.Reader{
+		AvailableTFVersions: []*version.Version{mustVersion(t, "0.12.29")},
+	}
+	_, err := r.DetectTerraformVersion(tmp, ".")
+	assert.Error(t, err)
+}